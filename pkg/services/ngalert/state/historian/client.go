@@ -0,0 +1,371 @@
+package historian
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+// LokiConfig holds the configuration needed to talk to a Loki instance used as the
+// backing store for alert state history.
+type LokiConfig struct {
+	WritePathURL      *url.URL
+	ReadPathURL       *url.URL
+	BasicAuthUser     string
+	BasicAuthPassword string
+	TenantID          string
+	ExternalLabels    map[string]string
+
+	// QueryPageLimit is the page size used when paginating query_range calls. Defaults to
+	// defaultQueryPageLimit when unset.
+	QueryPageLimit int64
+	// MaxPages caps how many pages a single QueryStates call will fetch before returning a
+	// truncated, warning-annotated result. Defaults to defaultMaxPages when unset.
+	MaxPages int
+
+	// WriteSchemaVersion selects the lokiEntry wire format used for newly written history
+	// entries. Defaults to SchemaVersion 1 when unset; reads always understand both versions.
+	WriteSchemaVersion int
+
+	// TenantHeaderMode routes each Grafana org's state history through its own
+	// X-Scope-OrgID header instead of the static TenantID, letting operators use Loki's
+	// per-tenant limits, retention and quotas for alert history isolation.
+	TenantHeaderMode bool
+	// TenantResolver maps orgID to the tenant string used in the header when
+	// TenantHeaderMode is enabled. Defaults to stringifying the orgID when unset.
+	TenantResolver TenantResolver
+}
+
+// Selector is a single label matcher used to build a LogQL stream selector.
+type Selector struct {
+	Label    string
+	Operator string
+	Value    string
+}
+
+// NewSelector creates a Selector, validating that the operator is one LogQL understands.
+func NewSelector(label, op, value string) (Selector, error) {
+	if !isValidOperator(op) {
+		return Selector{}, fmt.Errorf("'%s' is not a valid query operator", op)
+	}
+	return Selector{Label: label, Operator: op, Value: value}, nil
+}
+
+func isValidOperator(op string) bool {
+	switch op {
+	case "=", "!=", "=~", "!~":
+		return true
+	}
+	return false
+}
+
+func (s Selector) String() string {
+	return fmt.Sprintf("%s%s%q", s.Label, s.Operator, s.Value)
+}
+
+// selectorString renders a set of Selectors as a LogQL stream selector, e.g. `{foo="bar",baz="qux"}`.
+func selectorString(selectors []Selector) string {
+	parts := make([]string, len(selectors))
+	for i, s := range selectors {
+		parts[i] = s.String()
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// row is a single log line to be pushed to Loki, paired with its timestamp.
+type row struct {
+	At  time.Time
+	Val string
+}
+
+func (r row) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]string{strconv.FormatInt(r.At.UnixNano(), 10), r.Val})
+}
+
+// stream is a set of log lines that all share the same labels, in the shape the Loki push API expects.
+type stream struct {
+	Stream data.Labels `json:"stream"`
+	Values []row       `json:"values"`
+}
+
+// lokiResult is a single entry of a `streams`-typed Loki query result.
+type lokiResult struct {
+	Stream data.Labels `json:"stream"`
+	Values [][2]string `json:"values"`
+}
+
+// matrixResult is a single series of a `matrix`-typed Loki query result, as returned by
+// metric queries (e.g. count_over_time).
+type matrixResult struct {
+	Metric map[string]string `json:"metric"`
+	Values []matrixSample    `json:"values"`
+}
+
+// matrixSample is a single `[timestamp, "value"]` point of a matrix series. Unlike streams,
+// Loki encodes the timestamp as a JSON number (fractional seconds) here.
+type matrixSample struct {
+	Timestamp float64
+	Value     string
+}
+
+func (s *matrixSample) UnmarshalJSON(b []byte) error {
+	var raw [2]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	ts, ok := raw[0].(float64)
+	if !ok {
+		return fmt.Errorf("unexpected matrix sample timestamp type %T", raw[0])
+	}
+	val, ok := raw[1].(string)
+	if !ok {
+		return fmt.Errorf("unexpected matrix sample value type %T", raw[1])
+	}
+	s.Timestamp = ts
+	s.Value = val
+	return nil
+}
+
+type queryData struct {
+	ResultType string
+	Result     []lokiResult
+	Matrix     []matrixResult
+}
+
+// UnmarshalJSON decodes `result` according to `resultType`, since Loki shapes it as either a
+// list of streams or a list of matrix series depending on the kind of query that was run.
+func (d *queryData) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	d.ResultType = raw.ResultType
+	if len(raw.Result) == 0 {
+		return nil
+	}
+	switch raw.ResultType {
+	case "matrix":
+		return json.Unmarshal(raw.Result, &d.Matrix)
+	default:
+		return json.Unmarshal(raw.Result, &d.Result)
+	}
+}
+
+// QueryRes is the decoded response body of a Loki query_range call.
+type QueryRes struct {
+	Data queryData `json:"data"`
+}
+
+type lokiClient struct {
+	client http.Client
+	cfg    LokiConfig
+	log    log.Logger
+}
+
+func newLokiClient(cfg LokiConfig, logger log.Logger) *lokiClient {
+	return &lokiClient{
+		client: http.Client{},
+		cfg:    cfg,
+		log:    logger,
+	}
+}
+
+func (c *lokiClient) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.ReadPathURL.String()+"/loki/api/v1/labels", nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.doRequest(req, "")
+	if err != nil {
+		return fmt.Errorf("failed to reach loki: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("loki returned non-200 ping status: %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (c *lokiClient) push(ctx context.Context, tenant string, s []stream) error {
+	body, err := json.Marshal(struct {
+		Streams []stream `json:"streams"`
+	}{Streams: s})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.WritePathURL.String()+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.doRequest(req, tenant)
+	if err != nil {
+		return fmt.Errorf("failed to push logs to loki: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode >= 400 {
+		msg, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("loki returned non-200 push status: %d, msg: %s", res.StatusCode, string(msg))
+	}
+	return nil
+}
+
+func (c *lokiClient) query(ctx context.Context, selectors []Selector, pipeline, tenant string, start, end, limit int64) (QueryRes, error) {
+	v := url.Values{}
+	v.Set("query", selectorString(selectors)+pipeline)
+	v.Set("start", fmt.Sprintf("%d", start))
+	v.Set("end", fmt.Sprintf("%d", end))
+	v.Set("direction", "forward")
+	v.Set("limit", fmt.Sprintf("%d", limit))
+
+	var res QueryRes
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.ReadPathURL.String()+"/loki/api/v1/query_range?"+v.Encode(), nil)
+	if err != nil {
+		return res, err
+	}
+	resp, err := c.doRequest(req, tenant)
+	if err != nil {
+		return res, fmt.Errorf("failed to query loki: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(resp.Body)
+		return res, fmt.Errorf("loki returned non-200 query status: %d, msg: %s", resp.StatusCode, string(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, fmt.Errorf("failed to decode loki query response: %w", err)
+	}
+	return res, nil
+}
+
+// queryMetric issues a Loki metric range query (e.g. an aggregation like count_over_time)
+// and returns the decoded matrix result.
+func (c *lokiClient) queryMetric(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error) {
+	v := url.Values{}
+	v.Set("query", expr)
+	v.Set("start", fmt.Sprintf("%d", start))
+	v.Set("end", fmt.Sprintf("%d", end))
+	v.Set("step", formatLogQLDuration(step))
+
+	var res QueryRes
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.ReadPathURL.String()+"/loki/api/v1/query_range?"+v.Encode(), nil)
+	if err != nil {
+		return res, err
+	}
+	resp, err := c.doRequest(req, tenant)
+	if err != nil {
+		return res, fmt.Errorf("failed to query loki: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(resp.Body)
+		return res, fmt.Errorf("loki returned non-200 query status: %d, msg: %s", resp.StatusCode, string(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, fmt.Errorf("failed to decode loki query response: %w", err)
+	}
+	return res, nil
+}
+
+// formatLogQLDuration renders d in the plain-seconds form LogQL range/step durations accept.
+func formatLogQLDuration(d time.Duration) string {
+	if d <= 0 {
+		d = time.Minute
+	}
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// tail opens a long-lived websocket connection to Loki's tail endpoint and streams decoded
+// responses on the returned channel until ctx is cancelled or an unrecoverable error occurs,
+// at which point errCh receives the error and both channels are closed.
+func (c *lokiClient) tail(ctx context.Context, selectors []Selector, pipeline, tenant string) (<-chan tailResponse, <-chan error) {
+	resCh := make(chan tailResponse)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(resCh)
+		defer close(errCh)
+
+		tailURL := *c.cfg.ReadPathURL
+		switch tailURL.Scheme {
+		case "https":
+			tailURL.Scheme = "wss"
+		default:
+			tailURL.Scheme = "ws"
+		}
+		tailURL.Path = strings.TrimSuffix(tailURL.Path, "/") + "/loki/api/v1/tail"
+		v := url.Values{}
+		v.Set("query", selectorString(selectors)+pipeline)
+		tailURL.RawQuery = v.Encode()
+
+		header := http.Header{}
+		if c.cfg.BasicAuthUser != "" {
+			req := &http.Request{Header: header}
+			req.SetBasicAuth(c.cfg.BasicAuthUser, c.cfg.BasicAuthPassword)
+		}
+		if tenant != "" {
+			header.Set("X-Scope-OrgID", tenant)
+		} else if c.cfg.TenantID != "" {
+			header.Set("X-Scope-OrgID", c.cfg.TenantID)
+		}
+
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, tailURL.String(), header)
+		if err != nil {
+			errCh <- fmt.Errorf("failed to dial loki tail endpoint: %w", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		go func() {
+			<-ctx.Done()
+			_ = conn.Close()
+		}()
+
+		for {
+			var tr tailResponse
+			if err := conn.ReadJSON(&tr); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				errCh <- fmt.Errorf("lost loki tail connection: %w", err)
+				return
+			}
+			select {
+			case resCh <- tr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return resCh, errCh
+}
+
+// doRequest sets auth and tenant headers before issuing req. tenant, when non-empty,
+// overrides the statically configured TenantID for this request.
+func (c *lokiClient) doRequest(req *http.Request, tenant string) (*http.Response, error) {
+	if c.cfg.BasicAuthUser != "" {
+		req.SetBasicAuth(c.cfg.BasicAuthUser, c.cfg.BasicAuthPassword)
+	}
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	} else if c.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.cfg.TenantID)
+	}
+	return c.client.Do(req)
+}
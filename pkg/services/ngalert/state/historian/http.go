@@ -0,0 +1,88 @@
+package historian
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/ngalert/models"
+)
+
+// StateStatsRoute is the path StateStatsHandler is mounted at.
+const StateStatsRoute = "/api/v1/rules/history/stats"
+
+// StateStatsHandler serves aggregated state transition counts over HTTP, backed by a
+// RemoteLokiBackend's QueryStateStats. It is meant to be mounted by the ngalert API router
+// alongside the existing state history query endpoint.
+type StateStatsHandler struct {
+	backend *RemoteLokiBackend
+}
+
+func NewStateStatsHandler(backend *RemoteLokiBackend) *StateStatsHandler {
+	return &StateStatsHandler{backend: backend}
+}
+
+// RegisterStateStatsRoute mounts a StateStatsHandler for backend on mux at StateStatsRoute.
+// Call this from the ngalert API's route registration, alongside where the existing state
+// history query endpoint is registered, so /api/v1/rules/history/stats is actually reachable.
+func RegisterStateStatsRoute(mux *http.ServeMux, backend *RemoteLokiBackend) {
+	mux.Handle(StateStatsRoute, NewStateStatsHandler(backend))
+}
+
+// ServeHTTP expects orgId, ruleUID, from, to (unix seconds) and an optional step (e.g. "1m",
+// defaulting to one minute) as query parameters, and writes the resulting frame as JSON.
+func (h *StateStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	orgID, err := strconv.ParseInt(q.Get("orgId"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid or missing orgId", http.StatusBadRequest)
+		return
+	}
+	from, err := parseUnixSeconds(q.Get("from"))
+	if err != nil {
+		http.Error(w, "invalid or missing from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseUnixSeconds(q.Get("to"))
+	if err != nil {
+		http.Error(w, "invalid or missing to", http.StatusBadRequest)
+		return
+	}
+
+	step := time.Minute
+	if raw := q.Get("step"); raw != "" {
+		step, err = time.ParseDuration(raw)
+		if err != nil {
+			http.Error(w, "invalid step", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query := models.HistoryQuery{
+		OrgID:   orgID,
+		RuleUID: q.Get("ruleUID"),
+		From:    from,
+		To:      to,
+	}
+
+	frame, err := h.backend.QueryStateStats(r.Context(), query, step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(frame); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func parseUnixSeconds(raw string) (time.Time, error) {
+	sec, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
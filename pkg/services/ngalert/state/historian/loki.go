@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -36,32 +38,92 @@ const (
 
 type remoteLokiClient interface {
 	ping(context.Context) error
-	push(context.Context, []stream) error
-	query(ctx context.Context, selectors []Selector, start, end int64) (QueryRes, error)
+	push(ctx context.Context, tenant string, streams []stream) error
+	query(ctx context.Context, selectors []Selector, pipeline, tenant string, start, end, limit int64) (QueryRes, error)
+	queryMetric(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error)
+	tail(ctx context.Context, selectors []Selector, pipeline, tenant string) (<-chan tailResponse, <-chan error)
 }
 
+// TenantResolver maps a Grafana orgID to the tenant string sent in the X-Scope-OrgID
+// header when LokiConfig.TenantHeaderMode is enabled. Enterprise builds can supply their
+// own resolver to map onto a different tenant naming scheme.
+type TenantResolver interface {
+	Resolve(orgID int64) string
+}
+
+type defaultTenantResolver struct{}
+
+func (defaultTenantResolver) Resolve(orgID int64) string {
+	return strconv.FormatInt(orgID, 10)
+}
+
+// defaultQueryPageLimit is the page size used for each query_range call when paginating
+// through QueryStates results, unless overridden by LokiConfig.QueryPageLimit.
+const defaultQueryPageLimit = 1000
+
+// defaultMaxPages bounds how many pages QueryStates will fetch before giving up and
+// returning a truncated result, unless overridden by LokiConfig.MaxPages.
+const defaultMaxPages = 100
+
 type RemoteLokiBackend struct {
-	client         remoteLokiClient
-	externalLabels map[string]string
-	log            log.Logger
+	client             remoteLokiClient
+	externalLabels     map[string]string
+	queryPageLimit     int64
+	maxPages           int
+	writeSchemaVersion int
+	tenantHeaderMode   bool
+	tenantResolver     TenantResolver
+	log                log.Logger
 }
 
 func NewRemoteLokiBackend(cfg LokiConfig) *RemoteLokiBackend {
 	logger := log.New("ngalert.state.historian", "backend", "loki")
+
+	queryPageLimit := cfg.QueryPageLimit
+	if queryPageLimit <= 0 {
+		queryPageLimit = defaultQueryPageLimit
+	}
+	maxPages := cfg.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+	writeSchemaVersion := cfg.WriteSchemaVersion
+	if writeSchemaVersion <= 0 {
+		writeSchemaVersion = lokiEntrySchemaV1
+	}
+	tenantResolver := cfg.TenantResolver
+	if tenantResolver == nil {
+		tenantResolver = defaultTenantResolver{}
+	}
+
 	return &RemoteLokiBackend{
-		client:         newLokiClient(cfg, logger),
-		externalLabels: cfg.ExternalLabels,
-		log:            logger,
+		client:             newLokiClient(cfg, logger),
+		externalLabels:     cfg.ExternalLabels,
+		queryPageLimit:     queryPageLimit,
+		maxPages:           maxPages,
+		writeSchemaVersion: writeSchemaVersion,
+		tenantHeaderMode:   cfg.TenantHeaderMode,
+		tenantResolver:     tenantResolver,
+		log:                logger,
 	}
 }
 
+// tenantFor returns the X-Scope-OrgID header value for orgID when tenant header mode is
+// enabled, or "" otherwise (meaning the client falls back to its static configured tenant, if any).
+func (h *RemoteLokiBackend) tenantFor(orgID int64) string {
+	if !h.tenantHeaderMode {
+		return ""
+	}
+	return h.tenantResolver.Resolve(orgID)
+}
+
 func (h *RemoteLokiBackend) TestConnection(ctx context.Context) error {
 	return h.client.ping(ctx)
 }
 
 func (h *RemoteLokiBackend) RecordStatesAsync(ctx context.Context, rule history_model.RuleMeta, states []state.StateTransition) <-chan error {
 	logger := h.log.FromContext(ctx)
-	streams := statesToStreams(rule, states, h.externalLabels, logger)
+	streams := statesToStreams(rule, states, h.externalLabels, h.writeSchemaVersion, logger)
 	errCh := make(chan error, 1)
 	go func() {
 		defer close(errCh)
@@ -74,57 +136,338 @@ func (h *RemoteLokiBackend) RecordStatesAsync(ctx context.Context, rule history_
 }
 
 func (h *RemoteLokiBackend) QueryStates(ctx context.Context, query models.HistoryQuery) (*data.Frame, error) {
-	selectors, err := buildSelectors(query)
+	selectors, pipeline, err := h.buildSelectors(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build the provided selectors: %w", err)
 	}
+	tenant := h.tenantFor(query.OrgID)
 	// Timestamps are expected in RFC3339Nano.
-	res, err := h.client.query(ctx, selectors, query.From.UnixNano(), query.To.UnixNano())
+	res, warnings, err := h.queryPaginated(ctx, selectors, pipeline, tenant, query.From.UnixNano(), query.To.UnixNano())
 	if err != nil {
 		return nil, err
 	}
-	return merge(res, query.RuleUID)
+	frame, err := merge(res, query.RuleUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		frame.Meta = &data.FrameMeta{Notices: make([]data.Notice, 0, len(warnings))}
+		for _, w := range warnings {
+			frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: w})
+		}
+	}
+	return frame, nil
 }
 
-func buildSelectors(query models.HistoryQuery) ([]Selector, error) {
-	// +2 as OrgID and the state history label will always be selectors at the API level.
-	selectors := make([]Selector, len(query.Labels)+2)
+// queryPaginated loops calls to the underlying client's query_range, re-requesting from the
+// last page's maximum timestamp (inclusive) each time a page comes back full, until a page
+// comes back short (meaning we've reached the end) or h.maxPages is hit. Loki's own
+// max_entries_limit_per_query means a single query_range call can silently truncate busy
+// rules; this avoids that. Because query_range's start is inclusive, every entry at the
+// boundary timestamp is re-returned on the following page; lastSeen records exactly those
+// entries so they're deduped rather than duplicated in the merged result.
+func (h *RemoteLokiBackend) queryPaginated(ctx context.Context, selectors []Selector, pipeline, tenant string, start, end int64) (QueryRes, []string, error) {
+	merged := make(map[string]*lokiResult)
+	order := make([]string, 0)
+	lastSeen := make(map[string]map[[2]string]struct{})
+	var warnings []string
+
+	for page := 1; ; page++ {
+		res, err := h.client.query(ctx, selectors, pipeline, tenant, start, end, h.queryPageLimit)
+		if err != nil {
+			return QueryRes{}, nil, err
+		}
 
-	// Set the predefined selector orgID.
-	selector, err := NewSelector(OrgIDLabel, "=", fmt.Sprintf("%d", query.OrgID))
+		rawLen := 0
+		maxTs := start
+		// boundary collects every (ts, line) seen at maxTs in this page, becoming the next
+		// page's lastSeen so its inclusive re-fetch of maxTs can be deduped.
+		boundary := make(map[string]map[[2]string]struct{})
+		for _, result := range res.Data.Result {
+			key := result.Stream.String()
+			existing, ok := merged[key]
+			if !ok {
+				existing = &lokiResult{Stream: result.Stream}
+				merged[key] = existing
+				order = append(order, key)
+			}
+			for _, val := range result.Values {
+				rawLen++
+				if seen := lastSeen[key]; seen != nil {
+					if _, dup := seen[val]; dup {
+						// Already included as part of the previous page's boundary.
+						continue
+					}
+				}
+				existing.Values = append(existing.Values, val)
+
+				ts, perr := strconv.ParseInt(val[0], 10, 64)
+				if perr != nil {
+					continue
+				}
+				if ts > maxTs {
+					maxTs = ts
+					boundary = make(map[string]map[[2]string]struct{})
+				}
+				if ts == maxTs {
+					if boundary[key] == nil {
+						boundary[key] = make(map[[2]string]struct{})
+					}
+					boundary[key][val] = struct{}{}
+				}
+			}
+		}
+		lastSeen = boundary
+
+		// Whether to keep paging must be decided on the raw count Loki returned, not the
+		// post-dedup count: every page after the first re-returns the previous page's
+		// boundary entries (query_range's start is inclusive), so the post-dedup count is
+		// always short of a full page even when more data remains.
+		if rawLen < int(h.queryPageLimit) {
+			break
+		}
+		if maxTs <= start {
+			// The whole page shares a single timestamp equal to start: more entries share
+			// that timestamp than fit in one page, so we can't page past it without risking
+			// missed entries.
+			warnings = append(warnings, fmt.Sprintf("state history results were truncated: more than %d entries share the same timestamp (%d)", h.queryPageLimit, maxTs))
+			break
+		}
+		if maxTs > end {
+			break
+		}
+		if page >= h.maxPages {
+			warnings = append(warnings, fmt.Sprintf("state history results were truncated after %d pages (max_pages=%d); some entries may be missing", page, h.maxPages))
+			break
+		}
+		start = maxTs
+	}
+
+	result := make([]lokiResult, 0, len(order))
+	for _, key := range order {
+		result = append(result, *merged[key])
+	}
+	return QueryRes{Data: queryData{Result: result}}, warnings, nil
+}
+
+// QueryStateStats issues a LogQL metric query that aggregates transition counts per
+// `current` state into step-sized buckets (via count_over_time), so dashboards can render
+// "alert firing rate" / "flap frequency" panels without downloading and merging every entry.
+func (h *RemoteLokiBackend) QueryStateStats(ctx context.Context, query models.HistoryQuery, step time.Duration) (*data.Frame, error) {
+	selectors, pipeline, err := h.buildSelectors(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the provided selectors: %w", err)
+	}
+
+	expr := fmt.Sprintf(`sum by (current) (count_over_time(%s%s | json | current!="" [%s]))`,
+		selectorString(selectors), pipeline, formatLogQLDuration(step))
+
+	res, err := h.client.queryMetric(ctx, expr, h.tenantFor(query.OrgID), query.From.UnixNano(), query.To.UnixNano(), step)
 	if err != nil {
 		return nil, err
 	}
-	selectors[0] = selector
+	return matrixToFrame(res)
+}
+
+// matrixToFrame flattens a matrix-typed QueryRes into a long-format frame of
+// (time, current, count) rows sorted by time, so it renders the same way regardless of how
+// many `current` state series Loki returned.
+func matrixToFrame(res QueryRes) (*data.Frame, error) {
+	type point struct {
+		at      time.Time
+		current string
+		count   float64
+	}
+
+	points := make([]point, 0)
+	for _, series := range res.Data.Matrix {
+		current := series.Metric["current"]
+		for _, sample := range series.Values {
+			count, err := strconv.ParseFloat(sample.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse matrix sample value: %w", err)
+			}
+			points = append(points, point{
+				at:      time.Unix(0, int64(sample.Timestamp*float64(time.Second))),
+				current: current,
+				count:   count,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].at.Before(points[j].at) })
+
+	times := make([]time.Time, len(points))
+	currents := make([]string, len(points))
+	counts := make([]float64, len(points))
+	for i, p := range points {
+		times[i] = p.at
+		currents[i] = p.current
+		counts[i] = p.count
+	}
+
+	lbls := data.Labels(map[string]string{})
+	frame := data.NewFrame("state_stats",
+		data.NewField(dfTime, lbls, times),
+		data.NewField("current", lbls, currents),
+		data.NewField("count", lbls, counts),
+	)
+	return frame, nil
+}
+
+// tailResponse is the envelope Loki's /loki/api/v1/tail endpoint sends over the websocket
+// for each batch of new entries. It wraps the same `streams` shape used by query_range.
+type tailResponse struct {
+	Streams []lokiResult `json:"streams"`
+}
+
+// tailReconnectMinBackoff and tailReconnectMaxBackoff bound the delay between reconnect
+// attempts when the Loki tail websocket connection is lost.
+const (
+	tailReconnectMinBackoff = 500 * time.Millisecond
+	tailReconnectMaxBackoff = 30 * time.Second
+)
+
+// TailStates opens a live feed of state transitions matching query, re-connecting with
+// backoff if the underlying Loki tail connection drops. The returned channel is closed
+// once ctx is cancelled.
+func (h *RemoteLokiBackend) TailStates(ctx context.Context, query models.HistoryQuery) (<-chan *data.Frame, error) {
+	selectors, pipeline, err := h.buildSelectors(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the provided selectors: %w", err)
+	}
+
+	logger := h.log.FromContext(ctx)
+	frames := make(chan *data.Frame)
+	go h.runTail(ctx, selectors, pipeline, h.tenantFor(query.OrgID), frames, logger)
+	return frames, nil
+}
+
+func (h *RemoteLokiBackend) runTail(ctx context.Context, selectors []Selector, pipeline, tenant string, frames chan<- *data.Frame, logger log.Logger) {
+	defer close(frames)
+
+	backoff := tailReconnectMinBackoff
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		resCh, errCh := h.client.tail(ctx, selectors, pipeline, tenant)
+		connected := true
+		for connected {
+			select {
+			case <-ctx.Done():
+				return
+			case tr, ok := <-resCh:
+				if !ok {
+					connected = false
+					break
+				}
+				backoff = tailReconnectMinBackoff
+				frame, err := tailFrame(tr)
+				if err != nil {
+					logger.Warn("Skipping invalid entry from loki tail stream", "error", err)
+					continue
+				}
+				select {
+				case frames <- frame:
+				case <-ctx.Done():
+					return
+				}
+			case err, ok := <-errCh:
+				if ok && err != nil {
+					logger.Warn("Lost connection to loki tail endpoint, reconnecting", "error", err, "backoff", backoff)
+				}
+				connected = false
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > tailReconnectMaxBackoff {
+			backoff = tailReconnectMaxBackoff
+		}
+	}
+}
+
+// tailFrame decodes a single tail response into a data.Frame in the exact shape that merge
+// produces, by feeding it through the same multi-stream, timestamp-sorted merge logic. A tail
+// batch can contain entries from several streams at once, so this keeps TailStates frames
+// ordered identically to QueryStates frames rather than emitting them in stream-iteration order.
+func tailFrame(tr tailResponse) (*data.Frame, error) {
+	return merge(QueryRes{Data: queryData{Result: tr.Streams}}, "")
+}
+
+// buildSelectors returns the LogQL stream selectors for query, plus an optional pipeline
+// expression (built from query.LogQLFilter) to be appended after them. When tenant header
+// mode is enabled, orgID is sent via the X-Scope-OrgID header instead of as a selector.
+func (h *RemoteLokiBackend) buildSelectors(query models.HistoryQuery) ([]Selector, string, error) {
+	selectors := make([]Selector, 0, len(query.Labels)+2)
+
+	if !h.tenantHeaderMode {
+		// Set the predefined selector orgID.
+		selector, err := NewSelector(OrgIDLabel, "=", fmt.Sprintf("%d", query.OrgID))
+		if err != nil {
+			return nil, "", err
+		}
+		selectors = append(selectors, selector)
+	}
 
 	// Set the predefined selector for the state history label.
-	selector, err = NewSelector(StateHistoryLabelKey, "=", StateHistoryLabelValue)
+	selector, err := NewSelector(StateHistoryLabelKey, "=", StateHistoryLabelValue)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	selectors[1] = selector
+	selectors = append(selectors, selector)
 
 	// Set the label selectors
-	i := 2
 	for label, val := range query.Labels {
 		selector, err = NewSelector(label, "=", val)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
-		selectors[i] = selector
-		i++
+		selectors = append(selectors, selector)
 	}
 
 	// Set the optional special selector rule_id
 	if query.RuleUID != "" {
 		rsel, err := NewSelector(RuleUIDLabel, "=", query.RuleUID)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		selectors = append(selectors, rsel)
 	}
 
-	return selectors, nil
+	pipeline, err := buildLogQLPipeline(query.LogQLFilter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return selectors, pipeline, nil
+}
+
+// buildLogQLPipeline validates a caller-supplied LogQL pipeline expression and returns it
+// ready to be appended after the stream selector. Only pipeline stages (line filters,
+// parsers, label filters) are allowed here; the stream selector itself is always derived
+// from query.Labels above, so a filter that tries to smuggle in its own `{...}` selector
+// is rejected rather than silently concatenated.
+func buildLogQLPipeline(filter string) (string, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(filter, "|") {
+		return "", fmt.Errorf("logql filter must be a pipeline expression starting with '|'")
+	}
+	if strings.ContainsAny(filter, "{}") {
+		return "", fmt.Errorf("logql filter must not contain a stream selector")
+	}
+	return " " + filter, nil
 }
 
 // merge will put all the results in one array sorted by timestamp.
@@ -176,8 +519,7 @@ func merge(res QueryRes, ruleUID string) (*data.Frame, error) {
 		if minElStreamIdx == -1 {
 			break
 		}
-		var entry lokiEntry
-		err := json.Unmarshal([]byte(minEl[1]), &entry)
+		_, err := decodeLokiEntry(minEl[1])
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
 		}
@@ -210,7 +552,7 @@ func merge(res QueryRes, ruleUID string) (*data.Frame, error) {
 	return frame, nil
 }
 
-func statesToStreams(rule history_model.RuleMeta, states []state.StateTransition, externalLabels map[string]string, logger log.Logger) []stream {
+func statesToStreams(rule history_model.RuleMeta, states []state.StateTransition, externalLabels map[string]string, writeSchemaVersion int, logger log.Logger) []stream {
 	buckets := make(map[string][]row) // label repr -> entries
 	for _, state := range states {
 		if !shouldRecord(state) {
@@ -226,7 +568,7 @@ func statesToStreams(rule history_model.RuleMeta, states []state.StateTransition
 		repr := labels.String()
 
 		entry := lokiEntry{
-			SchemaVersion: 1,
+			SchemaVersion: lokiEntrySchemaV1,
 			Previous:      state.PreviousFormatted(),
 			Current:       state.Formatted(),
 			Values:        valuesAsDataBlob(state.State),
@@ -237,7 +579,18 @@ func statesToStreams(rule history_model.RuleMeta, states []state.StateTransition
 			entry.Error = state.Error.Error()
 		}
 
-		jsn, err := json.Marshal(entry)
+		var jsn []byte
+		var err error
+		if writeSchemaVersion >= lokiEntrySchemaV2 {
+			if v2, ok := entry.toV2(); ok {
+				jsn, err = json.Marshal(v2)
+			} else {
+				logger.Debug("State history entry has values that can't be represented in SchemaVersion 2, writing SchemaVersion 1 instead")
+				jsn, err = json.Marshal(entry)
+			}
+		} else {
+			jsn, err = json.Marshal(entry)
+		}
 		if err != nil {
 			logger.Error("Failed to construct history record for state, skipping", "error", err)
 			continue
@@ -267,13 +620,40 @@ func statesToStreams(rule history_model.RuleMeta, states []state.StateTransition
 }
 
 func (h *RemoteLokiBackend) recordStreams(ctx context.Context, streams []stream, logger log.Logger) error {
-	if err := h.client.push(ctx, streams); err != nil {
-		return err
+	if !h.tenantHeaderMode {
+		if err := h.client.push(ctx, "", streams); err != nil {
+			return err
+		}
+		logger.Debug("Done saving alert state history batch")
+		return nil
 	}
-	logger.Debug("Done saving alert state history batch")
+
+	byTenant := make(map[string][]stream)
+	tenantOrder := make([]string, 0)
+	for _, s := range streams {
+		tenant := h.tenantResolver.Resolve(orgIDFromLabels(s.Stream))
+		if _, ok := byTenant[tenant]; !ok {
+			tenantOrder = append(tenantOrder, tenant)
+		}
+		byTenant[tenant] = append(byTenant[tenant], s)
+	}
+
+	for _, tenant := range tenantOrder {
+		if err := h.client.push(ctx, tenant, byTenant[tenant]); err != nil {
+			return fmt.Errorf("failed to push state history for tenant %q: %w", tenant, err)
+		}
+	}
+	logger.Debug("Done saving alert state history batch", "tenants", len(tenantOrder))
 	return nil
 }
 
+// orgIDFromLabels extracts the Grafana orgID embedded as a stream label, so streams can be
+// grouped by tenant without threading the originating rule's orgID through separately.
+func orgIDFromLabels(labels data.Labels) int64 {
+	orgID, _ := strconv.ParseInt(labels[OrgIDLabel], 10, 64)
+	return orgID
+}
+
 func (h *RemoteLokiBackend) addExternalLabels(labels data.Labels) data.Labels {
 	for k, v := range h.externalLabels {
 		labels[k] = v
@@ -281,6 +661,11 @@ func (h *RemoteLokiBackend) addExternalLabels(labels data.Labels) data.Labels {
 	return labels
 }
 
+const (
+	lokiEntrySchemaV1 = 1
+	lokiEntrySchemaV2 = 2
+)
+
 type lokiEntry struct {
 	SchemaVersion int              `json:"schemaVersion"`
 	Previous      string           `json:"previous"`
@@ -291,6 +676,93 @@ type lokiEntry struct {
 	PanelID       int64            `json:"panelID"`
 }
 
+// lokiEntryV2 is the SchemaVersion 2 wire format for a history entry. It drops the nested
+// simplejson.Json wrapper around Values in favor of a flat map and shortens field names,
+// since rules with many query values produce the largest lines and dominate Loki chunk size.
+type lokiEntryV2 struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Previous      string             `json:"p"`
+	Current       string             `json:"c"`
+	Error         string             `json:"e,omitempty"`
+	Values        map[string]float64 `json:"v,omitempty"`
+	DashboardUID  string             `json:"d,omitempty"`
+	PanelID       int64              `json:"pid,omitempty"`
+}
+
+// toV2 downconverts a lokiEntry into the compact SchemaVersion 2 wire format. It returns
+// ok=false if Values contains anything that can't be represented as a flat
+// map[string]float64 (a non-numeric or nested value), so the caller can fall back to writing
+// the lossless v1 format instead of silently dropping data.
+func (e lokiEntry) toV2() (v2 lokiEntryV2, ok bool) {
+	var values map[string]float64
+	if e.Values != nil {
+		m, err := e.Values.Map()
+		if err != nil {
+			return lokiEntryV2{}, false
+		}
+		values = make(map[string]float64, len(m))
+		for k, v := range m {
+			f, ok := v.(float64)
+			if !ok {
+				return lokiEntryV2{}, false
+			}
+			values[k] = f
+		}
+	}
+	return lokiEntryV2{
+		SchemaVersion: lokiEntrySchemaV2,
+		Previous:      e.Previous,
+		Current:       e.Current,
+		Error:         e.Error,
+		Values:        values,
+		DashboardUID:  e.DashboardUID,
+		PanelID:       e.PanelID,
+	}, true
+}
+
+// toV1 upconverts a SchemaVersion 2 entry back into the canonical lokiEntry shape, so the
+// rest of the package never has to branch on which schema version a given line was written with.
+func (e lokiEntryV2) toV1() lokiEntry {
+	values := simplejson.New()
+	for k, v := range e.Values {
+		values.Set(k, v)
+	}
+	return lokiEntry{
+		SchemaVersion: lokiEntrySchemaV1,
+		Previous:      e.Previous,
+		Current:       e.Current,
+		Error:         e.Error,
+		Values:        values,
+		DashboardUID:  e.DashboardUID,
+		PanelID:       e.PanelID,
+	}
+}
+
+// decodeLokiEntry decodes a log line into the canonical lokiEntry shape regardless of
+// which SchemaVersion it was written with, so readers don't need to know about the wire format.
+func decodeLokiEntry(line string) (lokiEntry, error) {
+	var versioned struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal([]byte(line), &versioned); err != nil {
+		return lokiEntry{}, err
+	}
+
+	if versioned.SchemaVersion >= lokiEntrySchemaV2 {
+		var v2 lokiEntryV2
+		if err := json.Unmarshal([]byte(line), &v2); err != nil {
+			return lokiEntry{}, err
+		}
+		return v2.toV1(), nil
+	}
+
+	var v1 lokiEntry
+	if err := json.Unmarshal([]byte(line), &v1); err != nil {
+		return lokiEntry{}, err
+	}
+	return v1, nil
+}
+
 func valuesAsDataBlob(state *state.State) *simplejson.Json {
 	if state.State == eval.Error || state.State == eval.NoData {
 		return simplejson.New()
@@ -300,11 +772,11 @@ func valuesAsDataBlob(state *state.State) *simplejson.Json {
 }
 
 func jsonifyRow(line string) (json.RawMessage, error) {
-	// Ser/deser to validate the contents of the log line before shipping it forward.
-	// TODO: We may want to remove this in the future, as we already have the value in the form of a []byte, and json.RawMessage is also a []byte.
+	// Ser/deser to validate the contents of the log line before shipping it forward. This also
+	// transparently upconverts older SchemaVersions so callers always see the canonical shape.
 	// TODO: Though, if the log line does not contain valid JSON, this can cause problems later on when rendering the dataframe.
-	var entry lokiEntry
-	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+	entry, err := decodeLokiEntry(line)
+	if err != nil {
 		return nil, err
 	}
 	return json.Marshal(entry)
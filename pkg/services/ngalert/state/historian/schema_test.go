@@ -0,0 +1,116 @@
+package historian
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+func newTestEntry(t *testing.T) lokiEntry {
+	t.Helper()
+	values := simplejson.New()
+	values.Set("A", 1.5)
+	values.Set("B", 2.0)
+	return lokiEntry{
+		SchemaVersion: lokiEntrySchemaV1,
+		Previous:      "Normal",
+		Current:       "Alerting",
+		Values:        values,
+		DashboardUID:  "dash-uid",
+		PanelID:       1,
+	}
+}
+
+func TestLokiEntry_ToV2RoundTrip(t *testing.T) {
+	entry := newTestEntry(t)
+
+	v2, ok := entry.toV2()
+	require.True(t, ok)
+	require.Equal(t, lokiEntrySchemaV2, v2.SchemaVersion)
+
+	back := v2.toV1()
+	require.Equal(t, entry.Previous, back.Previous)
+	require.Equal(t, entry.Current, back.Current)
+	require.Equal(t, entry.DashboardUID, back.DashboardUID)
+
+	m, err := back.Values.Map()
+	require.NoError(t, err)
+	require.Equal(t, 1.5, m["A"])
+	require.Equal(t, 2.0, m["B"])
+}
+
+func TestLokiEntry_ToV2FallsBackOnNonNumericValues(t *testing.T) {
+	values := simplejson.New()
+	values.Set("A", "not-a-number")
+	entry := lokiEntry{SchemaVersion: lokiEntrySchemaV1, Current: "Alerting", Values: values}
+
+	_, ok := entry.toV2()
+	require.False(t, ok, "a non-numeric value must not be silently dropped by downconverting anyway")
+}
+
+// TestDecodeLokiEntry_MixedVersionStream verifies that a stream containing both
+// SchemaVersion 1 and SchemaVersion 2 lines (e.g. written before and after a config change
+// enabling LokiConfig.WriteSchemaVersion) decodes to the same canonical shape.
+func TestDecodeLokiEntry_MixedVersionStream(t *testing.T) {
+	v1 := newTestEntry(t)
+	v1Line, err := json.Marshal(v1)
+	require.NoError(t, err)
+
+	v2, ok := v1.toV2()
+	require.True(t, ok)
+	v2Line, err := json.Marshal(v2)
+	require.NoError(t, err)
+
+	decodedV1, err := decodeLokiEntry(string(v1Line))
+	require.NoError(t, err)
+	decodedV2, err := decodeLokiEntry(string(v2Line))
+	require.NoError(t, err)
+
+	require.Equal(t, decodedV1.Previous, decodedV2.Previous)
+	require.Equal(t, decodedV1.Current, decodedV2.Current)
+	require.Equal(t, decodedV1.DashboardUID, decodedV2.DashboardUID)
+
+	// Compare Values as JSON: v1 lines decode numbers as json.Number, v2 lines as float64.
+	j1, err := decodedV1.Values.MarshalJSON()
+	require.NoError(t, err)
+	j2, err := decodedV2.Values.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, string(j1), string(j2))
+}
+
+// BenchmarkLokiEntrySchemaSize compares the marshaled line size of the SchemaVersion 1 and
+// SchemaVersion 2 wire formats for a representative entry, since line size is what
+// WriteSchemaVersion 2 exists to reduce.
+func BenchmarkLokiEntrySchemaSize(b *testing.B) {
+	values := simplejson.New()
+	for i := 0; i < 10; i++ {
+		values.Set(string(rune('A'+i)), float64(i))
+	}
+	entry := lokiEntry{
+		SchemaVersion: lokiEntrySchemaV1,
+		Previous:      "Normal",
+		Current:       "Alerting",
+		Values:        values,
+		DashboardUID:  "dash-uid",
+		PanelID:       42,
+	}
+	v2, _ := entry.toV2()
+
+	b.Run("v1", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			line, err := json.Marshal(entry)
+			require.NoError(b, err)
+			b.SetBytes(int64(len(line)))
+		}
+	})
+	b.Run("v2", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			line, err := json.Marshal(v2)
+			require.NoError(b, err)
+			b.SetBytes(int64(len(line)))
+		}
+	})
+}
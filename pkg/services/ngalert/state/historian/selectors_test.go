@@ -0,0 +1,79 @@
+package historian
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/ngalert/models"
+)
+
+func TestBuildSelectors(t *testing.T) {
+	t.Run("labels and predefined selectors are rendered as a stream selector", func(t *testing.T) {
+		h := &RemoteLokiBackend{}
+		query := models.HistoryQuery{
+			OrgID:   1,
+			RuleUID: "rule-uid",
+			Labels:  map[string]string{"group": "my-group"},
+		}
+
+		selectors, pipeline, err := h.buildSelectors(query)
+		require.NoError(t, err)
+		require.Empty(t, pipeline)
+
+		got := selectorString(selectors)
+		require.Contains(t, got, `orgID="1"`)
+		require.Contains(t, got, `from="state-history"`)
+		require.Contains(t, got, `group="my-group"`)
+		require.Contains(t, got, `ruleUID="rule-uid"`)
+	})
+
+	t.Run("orgID is omitted from the selector in tenant header mode", func(t *testing.T) {
+		h := &RemoteLokiBackend{tenantHeaderMode: true}
+		query := models.HistoryQuery{OrgID: 1}
+
+		selectors, _, err := h.buildSelectors(query)
+		require.NoError(t, err)
+		require.NotContains(t, selectorString(selectors), "orgID=")
+	})
+
+	t.Run("a LogQLFilter is composed after the label selectors", func(t *testing.T) {
+		h := &RemoteLokiBackend{}
+		query := models.HistoryQuery{OrgID: 1, LogQLFilter: `|= "error" | json`}
+
+		selectors, pipeline, err := h.buildSelectors(query)
+		require.NoError(t, err)
+		require.Equal(t, ` |= "error" | json`, pipeline)
+		require.NotEmpty(t, selectors)
+	})
+
+	t.Run("a LogQLFilter that doesn't start with a pipe is rejected", func(t *testing.T) {
+		h := &RemoteLokiBackend{}
+		query := models.HistoryQuery{OrgID: 1, LogQLFilter: `count_over_time({foo="bar"}[5m])`}
+
+		_, _, err := h.buildSelectors(query)
+		require.Error(t, err)
+	})
+
+	t.Run("a LogQLFilter that smuggles in its own stream selector is rejected", func(t *testing.T) {
+		h := &RemoteLokiBackend{}
+		query := models.HistoryQuery{OrgID: 1, LogQLFilter: `| json | line_format "{{.foo}}" {bar="baz"}`}
+
+		_, _, err := h.buildSelectors(query)
+		require.Error(t, err)
+	})
+}
+
+func TestBuildLogQLPipeline(t *testing.T) {
+	t.Run("empty filter yields no pipeline", func(t *testing.T) {
+		pipeline, err := buildLogQLPipeline("")
+		require.NoError(t, err)
+		require.Empty(t, pipeline)
+	})
+
+	t.Run("a valid pipeline is prefixed with a space", func(t *testing.T) {
+		pipeline, err := buildLogQLPipeline(`| json | current="Alerting"`)
+		require.NoError(t, err)
+		require.Equal(t, ` | json | current="Alerting"`, pipeline)
+	})
+}
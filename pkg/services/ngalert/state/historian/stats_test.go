@@ -0,0 +1,120 @@
+package historian
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/ngalert/models"
+)
+
+// fakeLokiClient is a minimal remoteLokiClient stub for tests that only need to stub out
+// one or two methods; every method panics by default so an unexpected call fails loudly.
+type fakeLokiClient struct {
+	queryMetricFunc func(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error)
+}
+
+func (c *fakeLokiClient) ping(context.Context) error { panic("not implemented") }
+func (c *fakeLokiClient) push(context.Context, string, []stream) error {
+	panic("not implemented")
+}
+func (c *fakeLokiClient) query(context.Context, []Selector, string, string, int64, int64, int64) (QueryRes, error) {
+	panic("not implemented")
+}
+func (c *fakeLokiClient) queryMetric(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error) {
+	return c.queryMetricFunc(ctx, expr, tenant, start, end, step)
+}
+func (c *fakeLokiClient) tail(context.Context, []Selector, string, string) (<-chan tailResponse, <-chan error) {
+	panic("not implemented")
+}
+
+func newTestBackend(client remoteLokiClient) *RemoteLokiBackend {
+	return &RemoteLokiBackend{
+		client:         client,
+		queryPageLimit: defaultQueryPageLimit,
+		maxPages:       defaultMaxPages,
+		tenantResolver: defaultTenantResolver{},
+		log:            log.NewNopLogger(),
+	}
+}
+
+func matrixQueryRes() QueryRes {
+	return QueryRes{
+		Data: queryData{
+			ResultType: "matrix",
+			Matrix: []matrixResult{
+				{
+					Metric: map[string]string{"current": "Alerting"},
+					Values: []matrixSample{
+						{Timestamp: 1000, Value: "2"},
+						{Timestamp: 1060, Value: "1"},
+					},
+				},
+				{
+					Metric: map[string]string{"current": "Normal"},
+					Values: []matrixSample{
+						{Timestamp: 1000, Value: "5"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestQueryStateStats(t *testing.T) {
+	client := &fakeLokiClient{
+		queryMetricFunc: func(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error) {
+			require.Contains(t, expr, "count_over_time")
+			require.Contains(t, expr, `current!=""`)
+			return matrixQueryRes(), nil
+		},
+	}
+	h := newTestBackend(client)
+
+	query := models.HistoryQuery{OrgID: 1, RuleUID: "rule-uid"}
+	frame, err := h.QueryStateStats(context.Background(), query, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 3, frame.Fields[0].Len())
+}
+
+func TestMatrixToFrame(t *testing.T) {
+	frame, err := matrixToFrame(matrixQueryRes())
+	require.NoError(t, err)
+	require.Len(t, frame.Fields, 3)
+	require.Equal(t, 3, frame.Fields[0].Len())
+
+	// Rows must come out sorted by time.
+	times := frame.Fields[0]
+	for i := 1; i < times.Len(); i++ {
+		require.False(t, times.At(i).(time.Time).Before(times.At(i-1).(time.Time)))
+	}
+}
+
+func TestRegisterStateStatsRoute(t *testing.T) {
+	client := &fakeLokiClient{
+		queryMetricFunc: func(ctx context.Context, expr, tenant string, start, end int64, step time.Duration) (QueryRes, error) {
+			return matrixQueryRes(), nil
+		},
+	}
+	h := newTestBackend(client)
+
+	mux := http.NewServeMux()
+	RegisterStateStatsRoute(mux, h)
+
+	v := url.Values{}
+	v.Set("orgId", "1")
+	v.Set("ruleUID", "rule-uid")
+	v.Set("from", "0")
+	v.Set("to", "100")
+	req := httptest.NewRequest(http.MethodGet, StateStatsRoute+"?"+v.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}